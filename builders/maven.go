@@ -6,7 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
+	"runtime"
 	"strings"
 
 	"github.com/bmatcuk/doublestar"
@@ -50,6 +50,72 @@ type POMFile struct {
 	Description string   `xml:"description"`
 	Name        string   `xml:"name"`
 	URL         string   `xml:"url"`
+	Packaging   string   `xml:"packaging"`
+
+	Parent     *POMParent    `xml:"parent"`
+	Properties POMProperties `xml:"properties"`
+
+	// Modules lists the relative paths of a reactor POM's submodules, i.e.
+	// <modules><module>...</module></modules>. A non-empty Modules makes
+	// this POM an aggregator rather than a buildable artifact itself.
+	Modules []string `xml:"modules>module"`
+
+	Dependencies         []POMDependency         `xml:"dependencies>dependency"`
+	DependencyManagement POMDependencyManagement `xml:"dependencyManagement"`
+}
+
+// POMParent represents a pom.xml's <parent> reference, used to locate and
+// merge in the ancestor POM when resolving a project offline.
+type POMParent struct {
+	GroupID      string `xml:"groupId"`
+	ArtifactID   string `xml:"artifactId"`
+	Version      string `xml:"version"`
+	RelativePath string `xml:"relativePath"`
+}
+
+// POMDependency represents a single <dependency> entry, either in a
+// pom.xml's direct <dependencies> or in a <dependencyManagement> section.
+type POMDependency struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+	Version    string `xml:"version"`
+	Type       string `xml:"type"`
+	Scope      string `xml:"scope"`
+}
+
+// POMDependencyManagement represents a pom.xml's <dependencyManagement>
+// block, which pins dependency versions for both the declaring POM and,
+// when it's inherited, its descendants.
+type POMDependencyManagement struct {
+	Dependencies []POMDependency `xml:"dependencies>dependency"`
+}
+
+// POMProperties represents a pom.xml's <properties> block. Its children are
+// arbitrary user-defined element names rather than a fixed schema, so it
+// implements xml.Unmarshaler directly instead of using struct tags.
+type POMProperties map[string]string
+
+// UnmarshalXML reads each child element of <properties> as a key/value
+// pair, keyed on the element's own tag name.
+func (properties *POMProperties) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	props := make(POMProperties)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch elem := tok.(type) {
+		case xml.StartElement:
+			var value string
+			if err := d.DecodeElement(&value, &elem); err != nil {
+				return err
+			}
+			props[elem.Name.Local] = value
+		case xml.EndElement:
+			*properties = props
+			return nil
+		}
+	}
 }
 
 // MavenBuilder implements Builder for Apache Maven (*.pom.xml) builds
@@ -59,6 +125,16 @@ type MavenBuilder struct {
 
 	MvnCmd     string
 	MvnVersion string
+
+	// Offline selects POM-based analysis (see MavenOfflineResolver) instead
+	// of shelling out to `mvn dependency:tree`, so analysis needs neither a
+	// working `mvn` nor a fully buildable project. It defaults to true; set
+	// $MAVEN_ONLINE to fall back to the `mvn dependency:tree` path instead.
+	// Offline analysis only resolves dependencies declared directly in the
+	// module's own POM hierarchy, not the full transitive closure `mvn
+	// dependency:tree` reports, so Analyze warns loudly about this before
+	// running.
+	Offline bool
 }
 
 // Initialize collects metadata on Java and Maven binaries
@@ -73,10 +149,27 @@ func (builder *MavenBuilder) Initialize() error {
 	builder.JavaCmd = javaCmd
 	builder.JavaVersion = javaVersion
 
-	// Set Maven context variables
+	builder.Offline = os.Getenv("MAVEN_ONLINE") == ""
+
+	// Set Maven context variables. A missing system `mvn` is only fatal when
+	// we'll actually need to shell out to it: offline analysis doesn't, and
+	// neither does a project that ships its own `mvnw`/`mvnw.cmd` wrapper or
+	// has $FOSSA_MAVEN_CMD set, since mvnCmd prefers those over this binary
+	// regardless.
 	mavenCmd, mavenVersion, err := which("--version", os.Getenv("MAVEN_BINARY"), "mvn")
 	if err != nil {
-		return fmt.Errorf("could not find Maven binary (try setting $MAVEN_BINARY): %s", err.Error())
+		switch {
+		case builder.Offline:
+			log.Logger.Warningf("Could not find Maven binary, continuing with offline analysis: %s", err.Error())
+		case os.Getenv("FOSSA_MAVEN_CMD") != "":
+			log.Logger.Debugf("Could not find Maven binary, but $FOSSA_MAVEN_CMD is set: %s", err.Error())
+		default:
+			if wrapperDir, ok, wrapperErr := findWrapper("."); wrapperErr == nil && ok {
+				log.Logger.Debugf("Could not find Maven binary, but found a wrapper at %s", wrapperDir)
+			} else {
+				return fmt.Errorf("could not find Maven binary (try setting $MAVEN_BINARY): %s", err.Error())
+			}
+		}
 	}
 	builder.MvnCmd = mavenCmd
 	builder.MvnVersion = mavenVersion
@@ -85,18 +178,87 @@ func (builder *MavenBuilder) Initialize() error {
 	return nil
 }
 
+// mavenWrapperName is the project-pinned Maven wrapper script to search
+// for, which differs by platform.
+func mavenWrapperName() string {
+	if runtime.GOOS == "windows" {
+		return "mvnw.cmd"
+	}
+	return "mvnw"
+}
+
+// mvnCmd resolves the Maven command to invoke for the module rooted at dir.
+// $FOSSA_MAVEN_CMD always wins, for cases like pinning `mvnd` or a specific
+// wrapper path. Otherwise, a `mvnw`/`mvnw.cmd` found at dir or an ancestor
+// (up to the repository root) is preferred over the system-wide `mvn`
+// resolved in Initialize, so analysis matches whatever Maven version the
+// developer actually built with.
+func (builder *MavenBuilder) mvnCmd(dir string) string {
+	if cmd := os.Getenv("FOSSA_MAVEN_CMD"); cmd != "" {
+		return cmd
+	}
+
+	if wrapperDir, ok, err := findWrapper(dir); err == nil && ok {
+		return filepath.Join(wrapperDir, mavenWrapperName())
+	}
+
+	return builder.MvnCmd
+}
+
+// findWrapper searches dir and its ancestors for a `mvnw`/`mvnw.cmd`
+// wrapper, stopping at the repository root (the nearest ancestor containing
+// a .git directory) so a stray wrapper script outside the repository is
+// never picked up. If dir isn't inside a VCS checkout, it falls back to
+// searching all the way to the filesystem root. dir is resolved to an
+// absolute path up front: the ancestor walk below is driven by
+// filepath.Dir, which never advances past "." or other non-absolute
+// relative paths.
+func findWrapper(dir string) (string, bool, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false, err
+	}
+
+	wrapper := mavenWrapperName()
+	var foundRepoRoot bool
+	for current := absDir; ; {
+		if ok, err := isFile(current, wrapper); err != nil {
+			return "", false, err
+		} else if ok {
+			return current, true, nil
+		}
+
+		if ok, err := isFolder(current, ".git"); err != nil {
+			return "", false, err
+		} else if ok {
+			foundRepoRoot = true
+		}
+		if foundRepoRoot {
+			return "", false, nil
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return "", false, nil
+		}
+		current = parent
+	}
+}
+
 // Build runs `mvn install -DskipTests -Drat.skip=true` and cleans with `mvn clean`
 func (builder *MavenBuilder) Build(m module.Module, force bool) error {
 	log.Logger.Debugf("Running Maven build: %#v %#v", m, force)
 
+	mvnCmd := builder.mvnCmd(m.Dir)
+
 	if force {
-		_, _, err := runLogged(m.Dir, builder.MvnCmd, "clean")
+		_, _, err := runLogged(m.Dir, mvnCmd, "clean")
 		if err != nil {
 			return fmt.Errorf("could not remove Maven cache: %s", err.Error())
 		}
 	}
 
-	_, _, err := runLogged(m.Dir, builder.MvnCmd, "install", "-DskipTests", "-Drat.skip=true")
+	_, _, err := runLogged(m.Dir, mvnCmd, "install", "-DskipTests", "-Drat.skip=true")
 	if err != nil {
 		return fmt.Errorf("could not run Maven build: %s", err.Error())
 	}
@@ -105,82 +267,44 @@ func (builder *MavenBuilder) Build(m module.Module, force bool) error {
 	return nil
 }
 
-// Analyze parses the output of `mvn dependency:list`
+// Analyze parses the output of `mvn dependency:tree`, or, in offline mode,
+// resolves dependencies directly from the module's POM hierarchy (see
+// MavenOfflineResolver).
 func (builder *MavenBuilder) Analyze(m module.Module, allowUnresolved bool) ([]module.Dependency, error) {
 	log.Logger.Debugf("Running Maven analysis: %#v %#v", m, allowUnresolved)
 
-	output, _, err := runLogged(m.Dir, builder.MvnCmd, "dependency:tree")
-	if err != nil {
-		return nil, fmt.Errorf("could not get dependency list from Maven: %s", err.Error())
-	}
-
-	// Get dependency tree (rooted at each direct dependency).
-	lines := strings.Split(string(output), "\n")
-	startRegex := regexp.MustCompile("^\\[INFO\\] --- .*? ---$")
-	var depLines []string
-	inGraph := false
-	for _, line := range lines {
-		if startRegex.MatchString(line) {
-			if inGraph {
-				// Sanity check
-				log.Logger.Panicf("Bad graph separation: %s", line)
-			}
-			inGraph = true
-			continue
-		}
-		if line == "[INFO] " || line == "[INFO] ------------------------------------------------------------------------" {
-			inGraph = false
-			continue
-		}
-		if inGraph {
-			depLines = append(depLines, line)
+	if builder.Offline {
+		log.Logger.Warningf("Analyzing Maven module offline: this only resolves dependencies declared directly in the module's POM hierarchy, not their transitive dependencies.")
+		deps, err := NewMavenOfflineResolver().Analyze(m)
+		if err != nil {
+			return nil, fmt.Errorf("could not analyze Maven module offline: %s", err.Error())
 		}
+		log.Logger.Debugf("Done running Maven analysis: %#v", deps)
+		return deps, nil
 	}
 
-	// Parse dependency tree
-	var imports []Imported
-	root := module.Locator{
-		Fetcher:  "root",
-		Project:  "root",
-		Revision: "root",
-	}
-	from := module.ImportPath{root}
-	depRegex := regexp.MustCompile("^\\[INFO\\] ([ `+\\\\|-]*)([^ `+\\\\|-].+)$")
-	locatorRegex := regexp.MustCompile("([^:]+):([^:]+):([^:]*):([^:]+)")
-	for _, line := range depLines {
-		// Match for context
-		depMatches := depRegex.FindStringSubmatch(line)
-		depth := len(depMatches[1])
-		if depth%3 != 0 {
-			// Sanity check
-			log.Logger.Panicf("Bad depth: %#v %s %#v", depth, line, depMatches)
-		}
-		// Parse locator
-		locatorMatches := locatorRegex.FindStringSubmatch(depMatches[2])
-		locator := module.Locator{
-			Fetcher:  "mvn",
-			Project:  locatorMatches[1] + ":" + locatorMatches[2],
-			Revision: locatorMatches[4],
-		}
-		// Add to imports
-		from = from[:depth/3]
-		imports = append(imports, Imported{
-			Locator: locator,
-			From:    append(module.ImportPath{}, from...),
-		})
-		from = append(from, locator)
+	deps, err := builder.analyzeDependencyTree(m)
+	if err != nil {
+		return nil, err
 	}
-	deps := computeImportPaths(imports)
 
 	log.Logger.Debugf("Done running Maven analysis: %#v", deps)
 	return deps, nil
 }
 
-// IsBuilt checks whether `mvn dependency:list` produces output.
+// IsBuilt checks whether `mvn dependency:list` produces output. In offline
+// mode, a module is considered built as soon as its POM hierarchy parses,
+// since there's no `mvn` invocation to succeed or fail.
 func (builder *MavenBuilder) IsBuilt(m module.Module, allowUnresolved bool) (bool, error) {
 	log.Logger.Debugf("Checking Maven build: %#v %#v", m, allowUnresolved)
 
-	output, _, err := runLogged(m.Dir, builder.MvnCmd, "dependency:list", "-B")
+	if builder.Offline {
+		isBuilt, err := NewMavenOfflineResolver().IsBuilt(m)
+		log.Logger.Debugf("Done checking Maven build: %#v", isBuilt)
+		return isBuilt, err
+	}
+
+	output, _, err := runLogged(m.Dir, builder.mvnCmd(m.Dir), "dependency:list", "-B")
 	if err != nil {
 		if strings.Index(output, "Could not find artifact") != -1 {
 			return false, nil
@@ -202,24 +326,10 @@ func (builder *MavenBuilder) IsModule(target string) (bool, error) {
 func (builder *MavenBuilder) DiscoverModules(dir string) ([]module.Config, error) {
 	_, err := os.Stat(filepath.Join(dir, "pom.xml"))
 	if err == nil {
-		// Root pom found; parse and return
-		artifactName := filepath.Base(filepath.Dir(dir))
-		var rootPom POMFile
-		if err := parseLoggedWithUnmarshaller(filepath.Join(dir, "pom.xml"), &rootPom, xml.Unmarshal); err == nil {
-			if rootPom.Name != "" {
-				artifactName = rootPom.Name
-			} else if rootPom.ArtifactID != "" {
-				artifactName = rootPom.ArtifactID
-			}
-
-		}
-		return []module.Config{
-			{
-				Name: artifactName,
-				Path: "pom.xml",
-				Type: "mvn",
-			},
-		}, nil
+		// Root pom found; walk the reactor tree rooted at it rather than
+		// globbing, so multi-module projects resolve child modules relative
+		// to their declaring POM instead of being rediscovered independently.
+		return discoverReactorModules(dir, "")
 	}
 
 	// No pom in root directory; find and parse all of them
@@ -248,3 +358,48 @@ func (builder *MavenBuilder) DiscoverModules(dir string) ([]module.Config, error
 
 	return moduleConfigs, nil
 }
+
+// discoverReactorModules parses the pom.xml at rootDir/relPath/pom.xml and
+// recurses into its <modules>, so each submodule is resolved relative to
+// its declaring (aggregator) POM rather than rediscovered by glob. POMs
+// that either aggregate submodules or declare <packaging>pom</packaging>
+// (BOMs) aren't buildable artifacts themselves — an aggregator just wires
+// up its children, and a BOM's <dependencyManagement> is only ever a
+// version-pinning source consumed by other modules' analysis (see
+// MavenOfflineResolver's BOM-import handling) — so no module.Config is
+// emitted for them; they're only walked for their children.
+func discoverReactorModules(rootDir, relPath string) ([]module.Config, error) {
+	pomPath := filepath.Join(rootDir, relPath, "pom.xml")
+	var pom POMFile
+	if err := parseLoggedWithUnmarshaller(pomPath, &pom, xml.Unmarshal); err != nil {
+		return nil, err
+	}
+
+	var configs []module.Config
+	if len(pom.Modules) == 0 && pom.Packaging != "pom" {
+		artifactName := pom.Name
+		if artifactName == "" {
+			artifactName = pom.ArtifactID
+		}
+		if artifactName == "" {
+			artifactName = filepath.Base(filepath.Dir(pomPath))
+		}
+
+		configs = append(configs, module.Config{
+			Name: artifactName,
+			Path: filepath.Join(relPath, "pom.xml"),
+			Type: "mvn",
+		})
+	}
+
+	for _, child := range pom.Modules {
+		childConfigs, err := discoverReactorModules(rootDir, filepath.Join(relPath, child))
+		if err != nil {
+			log.Logger.Warningf("Could not resolve reactor module %s: %s", child, err.Error())
+			continue
+		}
+		configs = append(configs, childConfigs...)
+	}
+
+	return configs, nil
+}
@@ -0,0 +1,311 @@
+package builders
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+
+	"github.com/fossas/fossa-cli/log"
+	"github.com/fossas/fossa-cli/module"
+)
+
+// binaryArchiveExtensions lists the archive types MavenBinaryBuilder scans
+// for: a pre-built JAR, WAR, EAR, or PAR deliverable.
+var binaryArchiveExtensions = []string{"jar", "war", "ear", "par"}
+
+// nestedArchiveRegex matches nested jars vendored inside a WAR/EAR's lib
+// directories, at any nesting depth.
+var nestedArchiveRegex = regexp.MustCompile(`(^|/)(WEB-INF/lib|lib)/[^/]+\.jar$`)
+
+// MavenBinaryBuilder implements Builder for already-built Java archives
+// (*.jar/*.war/*.ear/*.par), for CI stages that only have the compiled
+// deliverable and for vendored closed-source jars, where there's no pom.xml
+// or working Maven install to analyze against.
+type MavenBinaryBuilder struct{}
+
+// Initialize is a no-op: binary analysis needs neither Java nor Maven.
+func (builder *MavenBinaryBuilder) Initialize() error {
+	return nil
+}
+
+// Build is a no-op: the archive is already built.
+func (builder *MavenBinaryBuilder) Build(m module.Module, force bool) error {
+	return nil
+}
+
+// Analyze recursively unzips m's archive and recovers Maven coordinates for
+// the archive itself and each nested jar from their embedded
+// pom.properties/pom.xml or Manifest, falling back to a SHA-1 hash locator
+// when no coordinates are embedded. Nested inclusion paths are preserved
+// with the outer archive as the via root.
+func (builder *MavenBinaryBuilder) Analyze(m module.Module, allowUnresolved bool) ([]module.Dependency, error) {
+	log.Logger.Debugf("Running Maven binary analysis: %#v %#v", m, allowUnresolved)
+
+	archivePath := filepath.Join(m.Dir, m.Target)
+	outer, err := identifyArchive(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not identify archive %s: %s", archivePath, err.Error())
+	}
+
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open archive %s: %s", archivePath, err.Error())
+	}
+	defer zr.Close()
+
+	root := module.Locator{
+		Fetcher:  "root",
+		Project:  "root",
+		Revision: "root",
+	}
+	imports := []Imported{{Locator: outer, From: module.ImportPath{root}}}
+	walkArchive(&zr.Reader, module.ImportPath{root, outer}, &imports)
+
+	deps := computeImportPaths(imports)
+	log.Logger.Debugf("Done running Maven binary analysis: %#v", deps)
+	return deps, nil
+}
+
+// walkArchive scans zr for nested archives (WEB-INF/lib/*.jar, lib/*.jar),
+// identifying each one and recursing into it in turn, threading from as the
+// accumulated import path.
+func walkArchive(zr *zip.Reader, from module.ImportPath, imports *[]Imported) {
+	for _, f := range zr.File {
+		if !nestedArchiveRegex.MatchString(f.Name) {
+			continue
+		}
+
+		locator, data, err := identifyZipEntry(f)
+		if err != nil {
+			log.Logger.Warningf("Could not identify nested archive %s: %s", f.Name, err.Error())
+			continue
+		}
+		*imports = append(*imports, Imported{
+			Locator: locator,
+			From:    append(module.ImportPath{}, from...),
+		})
+
+		if nested, err := zip.NewReader(bytes.NewReader(data), int64(len(data))); err == nil {
+			walkArchive(nested, append(append(module.ImportPath{}, from...), locator), imports)
+		}
+	}
+}
+
+// IsBuilt reports whether m's archive exists on disk: binary analysis has
+// no separate build step.
+func (builder *MavenBinaryBuilder) IsBuilt(m module.Module, allowUnresolved bool) (bool, error) {
+	return hasFile(m.Dir, m.Target)
+}
+
+// IsModule is not implemented
+func (builder *MavenBinaryBuilder) IsModule(target string) (bool, error) {
+	return false, errors.New("IsModule is not implemented for MavenBinaryBuilder")
+}
+
+// DiscoverModules finds every *.jar/*.war/*.ear/*.par under dir.
+func (builder *MavenBinaryBuilder) DiscoverModules(dir string) ([]module.Config, error) {
+	var moduleConfigs []module.Config
+	for _, ext := range binaryArchiveExtensions {
+		paths, err := doublestar.Glob(filepath.Join(dir, "**", "*."+ext))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			relPath, err := filepath.Rel(dir, path)
+			if err != nil {
+				return nil, err
+			}
+			moduleConfigs = append(moduleConfigs, module.Config{
+				Name: filepath.Base(path),
+				Path: relPath,
+				Type: "mvn-binary",
+			})
+		}
+	}
+	return moduleConfigs, nil
+}
+
+// identifyArchive recovers a Locator for the archive at path: its Maven
+// coordinates when embedded, or a SHA-1 hash locator (resolved server-side
+// against Maven Central's checksum index) otherwise.
+func identifyArchive(path string) (module.Locator, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return module.Locator{}, err
+	}
+	defer zr.Close()
+
+	if groupID, artifactID, version, ok := coordinatesFromZip(&zr.Reader); ok {
+		return module.Locator{Fetcher: "mvn", Project: groupID + ":" + artifactID, Revision: version}, nil
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return module.Locator{}, err
+	}
+	hash := sha1Hex(contents)
+	return module.Locator{Fetcher: "sha1", Project: hash, Revision: hash}, nil
+}
+
+// identifyZipEntry reads f (a nested jar) in full and recovers a Locator
+// for it the same way identifyArchive does, additionally returning its raw
+// bytes so callers can recurse into it without re-reading the archive.
+func identifyZipEntry(f *zip.File) (module.Locator, []byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return module.Locator{}, nil, err
+	}
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return module.Locator{}, nil, err
+	}
+
+	if zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data))); err == nil {
+		if groupID, artifactID, version, ok := coordinatesFromZip(zr); ok {
+			return module.Locator{Fetcher: "mvn", Project: groupID + ":" + artifactID, Revision: version}, data, nil
+		}
+	}
+
+	hash := sha1Hex(data)
+	return module.Locator{Fetcher: "sha1", Project: hash, Revision: hash}, data, nil
+}
+
+var (
+	pomPropertiesRegex = regexp.MustCompile(`^META-INF/maven/[^/]+/[^/]+/pom\.properties$`)
+	pomXMLRegex        = regexp.MustCompile(`^META-INF/maven/[^/]+/[^/]+/pom\.xml$`)
+)
+
+// coordinatesFromZip recovers Maven coordinates embedded in an archive, in
+// order of preference: META-INF/maven/.../pom.properties, then
+// META-INF/maven/.../pom.xml, then the Manifest's Implementation-Title and
+// Implementation-Version.
+func coordinatesFromZip(zr *zip.Reader) (groupID, artifactID, version string, ok bool) {
+	var manifest map[string]string
+	var pomGroupID, pomArtifactID, pomVersion string
+	for _, f := range zr.File {
+		switch {
+		case pomPropertiesRegex.MatchString(f.Name):
+			props, err := readProperties(f)
+			if err != nil {
+				continue
+			}
+			if props["groupId"] != "" && props["artifactId"] != "" {
+				return props["groupId"], props["artifactId"], props["version"], true
+			}
+		case pomXMLRegex.MatchString(f.Name):
+			pom, err := readPOMEntry(f)
+			if err != nil {
+				continue
+			}
+			if pom.GroupID != "" && pom.ArtifactID != "" && pomGroupID == "" {
+				pomGroupID, pomArtifactID, pomVersion = pom.GroupID, pom.ArtifactID, pom.Version
+			}
+		case f.Name == "META-INF/MANIFEST.MF":
+			if props, err := readManifest(f); err == nil {
+				manifest = props
+			}
+		}
+	}
+
+	if pomGroupID != "" {
+		return pomGroupID, pomArtifactID, pomVersion, true
+	}
+
+	// Older Maven-built jars sometimes stamp their groupId into the Manifest
+	// as Implementation-Vendor-Id. Without it, we have no real groupId, so
+	// fall through to the SHA-1 locator rather than emit a malformed
+	// "<empty>:artifactId" coordinate.
+	if groupID := manifest["Implementation-Vendor-Id"]; groupID != "" && manifest["Implementation-Title"] != "" {
+		return groupID, manifest["Implementation-Title"], manifest["Implementation-Version"], true
+	}
+
+	return "", "", "", false
+}
+
+// readProperties parses a Java .properties file's `key=value` lines.
+func readProperties(f *zip.File) (map[string]string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	props := make(map[string]string)
+	scanner := bufio.NewScanner(rc)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		props[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return props, scanner.Err()
+}
+
+// readPOMEntry parses an embedded pom.xml into a POMFile.
+func readPOMEntry(f *zip.File) (*POMFile, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var pom POMFile
+	if err := xml.NewDecoder(rc).Decode(&pom); err != nil {
+		return nil, err
+	}
+	return &pom, nil
+}
+
+// readManifest parses a JAR Manifest's `Key: Value` lines, joining
+// continuation lines (which start with a single space).
+func readManifest(f *zip.File) (map[string]string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	props := make(map[string]string)
+	var key string
+	scanner := bufio.NewScanner(rc)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			key = ""
+			continue
+		}
+		if strings.HasPrefix(line, " ") && key != "" {
+			props[key] += strings.TrimPrefix(line, " ")
+			continue
+		}
+		parts := strings.SplitN(line, ": ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key = parts[0]
+		props[key] = parts[1]
+	}
+	return props, scanner.Err()
+}
+
+func sha1Hex(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
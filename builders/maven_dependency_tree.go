@@ -0,0 +1,285 @@
+package builders
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/fossas/fossa-cli/log"
+	"github.com/fossas/fossa-cli/module"
+)
+
+// locatorRegex matches a Maven coordinate's groupId, artifactId, packaging,
+// and version, ignoring any trailing `:scope` field. Classifiers are not
+// recognized: in groupId:artifactId:type:classifier:version, the fourth
+// group captures the classifier rather than the version.
+var locatorRegex = regexp.MustCompile(`^([^:]+):([^:]+):([^:]*):([^:]+)`)
+
+// mavenTreeOutputType selects the `-DoutputType` passed to
+// `mvn dependency:tree`. "text" is the default, indentation-based format;
+// "tgf" and "graphml" encode parent-child edges explicitly, avoiding the
+// fragile depth%3==0 math the text format needs. Override with
+// $FOSSA_MAVEN_TREE_FORMAT.
+func mavenTreeOutputType() string {
+	switch format := os.Getenv("FOSSA_MAVEN_TREE_FORMAT"); format {
+	case "tgf", "graphml":
+		return format
+	default:
+		return "text"
+	}
+}
+
+// analyzeDependencyTree runs `mvn dependency:tree` against a
+// `-DoutputFile` file (the maven-dependency-plugin's property for this
+// goal; there is no `-Doutput`), instead of scanning interleaved INFO-log
+// stdout, then streams that file line-by-line so large reactors don't need
+// the full tree held in memory. A malformed line degrades to a logged
+// warning-and-skip rather than aborting the whole analysis.
+func (builder *MavenBuilder) analyzeDependencyTree(m module.Module) ([]module.Dependency, error) {
+	outputType := mavenTreeOutputType()
+
+	tmp, err := ioutil.TempFile("", "fossa-maven-dependency-tree")
+	if err != nil {
+		return nil, fmt.Errorf("could not create temp file for `mvn dependency:tree` output: %s", err.Error())
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	_, _, err = runLogged(m.Dir, builder.mvnCmd(m.Dir), "dependency:tree", "-DoutputType="+outputType, "-DoutputFile="+tmp.Name())
+	if err != nil {
+		return nil, fmt.Errorf("could not run `mvn dependency:tree`: %s", err.Error())
+	}
+
+	file, err := os.Open(tmp.Name())
+	if err != nil {
+		return nil, fmt.Errorf("could not read `mvn dependency:tree` output: %s", err.Error())
+	}
+	defer file.Close()
+
+	switch outputType {
+	case "tgf":
+		return parseTGFDependencyTree(file)
+	case "graphml":
+		return parseGraphMLDependencyTree(file)
+	default:
+		return parseTextDependencyTree(file)
+	}
+}
+
+// depthRegex splits a text-format tree line into its indentation marker
+// (whitespace, `+`, `-`, “ ` “, `|`, `\`) and the coordinate it precedes.
+var depthRegex = regexp.MustCompile("^([ `+\\\\|-]*)([^ `+\\\\|-].+)$")
+
+// parseTextDependencyTree parses the default indentation-based
+// `-DoutputType=text` format, where depth is encoded as a multiple of 3
+// leading marker characters per nesting level.
+func parseTextDependencyTree(r io.Reader) ([]module.Dependency, error) {
+	scanner := bufio.NewScanner(r)
+
+	var imports []Imported
+	root := module.Locator{
+		Fetcher:  "root",
+		Project:  "root",
+		Revision: "root",
+	}
+	from := module.ImportPath{root}
+
+	var offset int64
+	lineNum := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNum++
+		lineOffset := offset
+		offset += int64(len(line)) + 1
+
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		depMatches := depthRegex.FindStringSubmatch(line)
+		if depMatches == nil {
+			log.Logger.Warningf("Skipping malformed dependency tree line %d (byte offset %d): %q", lineNum, lineOffset, line)
+			continue
+		}
+		depth := len(depMatches[1])
+		if depth%3 != 0 {
+			log.Logger.Warningf("Skipping dependency tree line %d (byte offset %d) with unexpected indentation: %q", lineNum, lineOffset, line)
+			continue
+		}
+		if depth/3 > len(from) {
+			log.Logger.Warningf("Skipping dependency tree line %d (byte offset %d) nested deeper than its parent: %q", lineNum, lineOffset, line)
+			continue
+		}
+
+		locatorMatches := locatorRegex.FindStringSubmatch(depMatches[2])
+		if locatorMatches == nil {
+			log.Logger.Warningf("Skipping unparseable dependency coordinate at line %d (byte offset %d): %q", lineNum, lineOffset, depMatches[2])
+			continue
+		}
+
+		locator := module.Locator{
+			Fetcher:  "mvn",
+			Project:  locatorMatches[1] + ":" + locatorMatches[2],
+			Revision: locatorMatches[4],
+		}
+
+		from = from[:depth/3]
+		imports = append(imports, Imported{
+			Locator: locator,
+			From:    append(module.ImportPath{}, from...),
+		})
+		from = append(from, locator)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read dependency tree: %s", err.Error())
+	}
+
+	return computeImportPaths(imports), nil
+}
+
+// parseTGFDependencyTree parses the Trivial Graph Format, a node list
+// ("<id> <coordinate>" per line), a lone "#" separator, then an edge list
+// ("<fromId> <toId>" per line) that encodes parent-child edges explicitly.
+func parseTGFDependencyTree(r io.Reader) ([]module.Dependency, error) {
+	scanner := bufio.NewScanner(r)
+
+	nodes := make(map[string]module.Locator)
+	edges := make(map[string][]string)
+	var roots []string
+
+	inEdges := false
+	var offset int64
+	lineNum := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNum++
+		lineOffset := offset
+		offset += int64(len(line)) + 1
+
+		if line == "#" {
+			inEdges = true
+			continue
+		}
+
+		if !inEdges {
+			parts := strings.SplitN(line, " ", 2)
+			if len(parts) != 2 {
+				log.Logger.Warningf("Skipping malformed TGF node at line %d (byte offset %d): %q", lineNum, lineOffset, line)
+				continue
+			}
+			locatorMatches := locatorRegex.FindStringSubmatch(parts[1])
+			if locatorMatches == nil {
+				log.Logger.Warningf("Skipping unparseable TGF node coordinate at line %d (byte offset %d): %q", lineNum, lineOffset, parts[1])
+				continue
+			}
+			if len(nodes) == 0 {
+				roots = append(roots, parts[0])
+			}
+			nodes[parts[0]] = module.Locator{
+				Fetcher:  "mvn",
+				Project:  locatorMatches[1] + ":" + locatorMatches[2],
+				Revision: locatorMatches[4],
+			}
+			continue
+		}
+
+		// Edges are "<fromId> <toId> <scopeLabel>" -- the trailing scope
+		// label (e.g. "compile") is informational only and ignored here.
+		parts := strings.Fields(line)
+		if len(parts) < 2 {
+			log.Logger.Warningf("Skipping malformed TGF edge at line %d (byte offset %d): %q", lineNum, lineOffset, line)
+			continue
+		}
+		edges[parts[0]] = append(edges[parts[0]], parts[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read dependency tree: %s", err.Error())
+	}
+
+	var imports []Imported
+	for _, rootID := range roots {
+		locator := nodes[rootID]
+		imports = append(imports, Imported{Locator: locator, From: module.ImportPath{}})
+		walkTreeEdges(rootID, module.ImportPath{locator}, nodes, edges, &imports)
+	}
+	return computeImportPaths(imports), nil
+}
+
+// graphMLTree is the subset of Maven's `-DoutputType=graphml` schema we
+// need: nodes keyed on their full Maven coordinate, and the edges between
+// them.
+type graphMLTree struct {
+	XMLName xml.Name `xml:"graphml"`
+	Graph   struct {
+		Nodes []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"node"`
+		Edges []struct {
+			Source string `xml:"source,attr"`
+			Target string `xml:"target,attr"`
+		} `xml:"edge"`
+	} `xml:"graph"`
+}
+
+// parseGraphMLDependencyTree parses the GraphML format, whose nodes and
+// edges encode parent-child relationships explicitly rather than through
+// indentation.
+func parseGraphMLDependencyTree(r io.Reader) ([]module.Dependency, error) {
+	var tree graphMLTree
+	if err := xml.NewDecoder(r).Decode(&tree); err != nil {
+		return nil, fmt.Errorf("could not parse GraphML dependency tree: %s", err.Error())
+	}
+
+	nodes := make(map[string]module.Locator)
+	for _, n := range tree.Graph.Nodes {
+		locatorMatches := locatorRegex.FindStringSubmatch(n.ID)
+		if locatorMatches == nil {
+			log.Logger.Warningf("Skipping unparseable GraphML node coordinate: %q", n.ID)
+			continue
+		}
+		nodes[n.ID] = module.Locator{
+			Fetcher:  "mvn",
+			Project:  locatorMatches[1] + ":" + locatorMatches[2],
+			Revision: locatorMatches[4],
+		}
+	}
+
+	edges := make(map[string][]string)
+	hasIncoming := make(map[string]bool)
+	for _, e := range tree.Graph.Edges {
+		edges[e.Source] = append(edges[e.Source], e.Target)
+		hasIncoming[e.Target] = true
+	}
+
+	var imports []Imported
+	for id, locator := range nodes {
+		if hasIncoming[id] {
+			continue
+		}
+		imports = append(imports, Imported{Locator: locator, From: module.ImportPath{}})
+		walkTreeEdges(id, module.ImportPath{locator}, nodes, edges, &imports)
+	}
+
+	return computeImportPaths(imports), nil
+}
+
+// walkTreeEdges recurses through an explicit edge list (shared by the TGF
+// and GraphML parsers), threading from as the accumulated import path.
+func walkTreeEdges(id string, from module.ImportPath, nodes map[string]module.Locator, edges map[string][]string, imports *[]Imported) {
+	for _, childID := range edges[id] {
+		locator, ok := nodes[childID]
+		if !ok {
+			continue
+		}
+		*imports = append(*imports, Imported{
+			Locator: locator,
+			From:    append(module.ImportPath{}, from...),
+		})
+		walkTreeEdges(childID, append(append(module.ImportPath{}, from...), locator), nodes, edges, imports)
+	}
+}
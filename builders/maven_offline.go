@@ -0,0 +1,265 @@
+package builders
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/fossas/fossa-cli/log"
+	"github.com/fossas/fossa-cli/module"
+)
+
+// MavenOfflineResolver analyzes a Maven module by walking its pom.xml
+// hierarchy directly on disk, instead of shelling out to `mvn`. It follows
+// <parent> references up the filesystem and into the local Maven
+// repository, merges <properties> and <dependencyManagement> from the full
+// ancestor chain, and resolves the effective POM's dependencies from that
+// merged state.
+type MavenOfflineResolver struct {
+	// LocalRepo is the local Maven repository searched for parent POMs that
+	// aren't vendored alongside the module (e.g. ~/.m2/repository).
+	LocalRepo string
+}
+
+// NewMavenOfflineResolver constructs a MavenOfflineResolver, honoring
+// $MAVEN_LOCAL_REPO and falling back to ~/.m2/repository.
+func NewMavenOfflineResolver() MavenOfflineResolver {
+	repo := os.Getenv("MAVEN_LOCAL_REPO")
+	if repo == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			home = os.Getenv("USERPROFILE")
+		}
+		repo = filepath.Join(home, ".m2", "repository")
+	}
+	return MavenOfflineResolver{LocalRepo: repo}
+}
+
+// Analyze resolves m's dependencies from its POM hierarchy alone. Test and
+// provided-scope dependencies are skipped, since they aren't shipped with
+// the built artifact.
+func (r MavenOfflineResolver) Analyze(m module.Module) ([]module.Dependency, error) {
+	pom, err := r.resolvePOM(filepath.Join(m.Dir, "pom.xml"))
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve POM hierarchy: %s", err.Error())
+	}
+
+	var imports []Imported
+	root := module.Locator{
+		Fetcher:  "root",
+		Project:  "root",
+		Revision: "root",
+	}
+	from := module.ImportPath{root}
+	for _, dep := range pom.Dependencies {
+		if dep.Scope == "test" || dep.Scope == "provided" {
+			continue
+		}
+		locator := module.Locator{
+			Fetcher:  "mvn",
+			Project:  substituteProperties(pom, dep.GroupID) + ":" + substituteProperties(pom, dep.ArtifactID),
+			Revision: resolveDependencyVersion(pom, dep),
+		}
+		imports = append(imports, Imported{
+			Locator: locator,
+			From:    append(module.ImportPath{}, from...),
+		})
+	}
+
+	return computeImportPaths(imports), nil
+}
+
+// IsBuilt returns true as soon as m's POM hierarchy parses, since offline
+// analysis has no build step to fail.
+func (r MavenOfflineResolver) IsBuilt(m module.Module) (bool, error) {
+	_, err := r.resolvePOM(filepath.Join(m.Dir, "pom.xml"))
+	return err == nil, nil
+}
+
+// resolvePOM loads the pom.xml at path and recursively merges in its
+// ancestor chain.
+func (r MavenOfflineResolver) resolvePOM(path string) (*POMFile, error) {
+	return r.resolvePOMSeen(path, make(map[string]bool))
+}
+
+// resolvePOMSeen is resolvePOM's implementation. seen is shared across the
+// whole resolution — both the <parent> chain and any BOM imports pulled in
+// along the way — so a cycle in either (A's parent is B, B's parent is A; or
+// A imports BOM B, which imports BOM A) is caught once instead of recursing
+// forever.
+//
+// Properties are merged child-over-parent before dependencyManagement is
+// expanded, since a <dependencyManagement> BOM import's groupId/artifactId/
+// version is frequently a ${property} defined only in a parent POM.
+// Dependency management entries are appended parent-after-child so the
+// child's entries are matched first.
+func (r MavenOfflineResolver) resolvePOMSeen(path string, seen map[string]bool) (*POMFile, error) {
+	var pom POMFile
+	if err := parseLoggedWithUnmarshaller(path, &pom, xml.Unmarshal); err != nil {
+		return nil, err
+	}
+
+	var parent *POMFile
+	if pom.Parent != nil {
+		parentKey := pom.Parent.GroupID + ":" + pom.Parent.ArtifactID + ":" + pom.Parent.Version
+		if seen[parentKey] {
+			log.Logger.Warningf("Skipping circular parent POM reference to %s", parentKey)
+		} else {
+			seen[parentKey] = true
+			if parentPath, err := r.locateParentPOM(path, *pom.Parent); err != nil {
+				log.Logger.Warningf("Could not locate parent POM %s: %s", parentKey, err.Error())
+			} else if p, err := r.resolvePOMSeen(parentPath, seen); err != nil {
+				log.Logger.Warningf("Could not parse parent POM %s: %s", parentPath, err.Error())
+			} else {
+				parent = p
+			}
+		}
+	}
+
+	if parent != nil {
+		merged := make(POMProperties)
+		for k, v := range parent.Properties {
+			merged[k] = v
+		}
+		for k, v := range pom.Properties {
+			merged[k] = v
+		}
+		pom.Properties = merged
+
+		if pom.GroupID == "" {
+			pom.GroupID = pom.Parent.GroupID
+		}
+		if pom.Version == "" {
+			pom.Version = pom.Parent.Version
+		}
+	}
+
+	pom.DependencyManagement.Dependencies = r.expandImportedBOMs(&pom, pom.DependencyManagement.Dependencies, seen)
+
+	if parent != nil {
+		pom.DependencyManagement.Dependencies = append(pom.DependencyManagement.Dependencies, parent.DependencyManagement.Dependencies...)
+	}
+
+	return &pom, nil
+}
+
+// locateParentPOM finds a parent pom.xml on disk: first via the child's
+// relativePath (defaulting to "../pom.xml", per Maven convention), falling
+// back to <localRepo>/<groupId>/<artifactId>/<version>/<artifactId>-<version>.pom.
+func (r MavenOfflineResolver) locateParentPOM(childPath string, parent POMParent) (string, error) {
+	relPath := parent.RelativePath
+	if relPath == "" {
+		relPath = "../pom.xml"
+	}
+	candidate := filepath.Join(filepath.Dir(childPath), relPath)
+	if info, err := os.Stat(candidate); err == nil {
+		if info.IsDir() {
+			candidate = filepath.Join(candidate, "pom.xml")
+		}
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+
+	if repoPath, err := r.locateRepoPOM(parent.GroupID, parent.ArtifactID, parent.Version); err == nil {
+		return repoPath, nil
+	}
+
+	return "", fmt.Errorf("no parent POM found at %s or in local repo", candidate)
+}
+
+// locateRepoPOM finds a POM in the local Maven repository by coordinates,
+// as used for both parent POMs not vendored alongside the module and
+// <dependencyManagement> BOM imports, which are identified by
+// groupId/artifactId/version rather than a relative path.
+func (r MavenOfflineResolver) locateRepoPOM(groupID, artifactID, version string) (string, error) {
+	repoPath := filepath.Join(r.LocalRepo, filepath.FromSlash(strings.Replace(groupID, ".", "/", -1)), artifactID, version, artifactID+"-"+version+".pom")
+	if _, err := os.Stat(repoPath); err == nil {
+		return repoPath, nil
+	}
+	return "", fmt.Errorf("no POM found at %s", repoPath)
+}
+
+// expandImportedBOMs replaces each scope=import/type=pom entry in deps with
+// the imported BOM's own (recursively expanded) dependencyManagement
+// entries, per Maven's BOM-import semantics. seen guards against
+// re-importing (and infinite-looping on) the same BOM coordinate twice.
+func (r MavenOfflineResolver) expandImportedBOMs(pom *POMFile, deps []POMDependency, seen map[string]bool) []POMDependency {
+	var expanded []POMDependency
+	for _, dep := range deps {
+		if dep.Scope != "import" || dep.Type != "pom" {
+			expanded = append(expanded, dep)
+			continue
+		}
+
+		groupID := substituteProperties(pom, dep.GroupID)
+		artifactID := substituteProperties(pom, dep.ArtifactID)
+		version := substituteProperties(pom, dep.Version)
+		key := groupID + ":" + artifactID + ":" + version
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		bomPath, err := r.locateRepoPOM(groupID, artifactID, version)
+		if err != nil {
+			log.Logger.Warningf("Could not locate imported BOM %s: %s", key, err.Error())
+			continue
+		}
+		bom, err := r.resolvePOMSeen(bomPath, seen)
+		if err != nil {
+			log.Logger.Warningf("Could not parse imported BOM %s: %s", key, err.Error())
+			continue
+		}
+		// bom.DependencyManagement.Dependencies is already fully expanded:
+		// resolvePOMSeen ran expandImportedBOMs on it before returning.
+		expanded = append(expanded, bom.DependencyManagement.Dependencies...)
+	}
+	return expanded
+}
+
+var pomPropertyRegex = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// substituteProperties replaces ${...} placeholders in value with entries
+// from pom's merged properties, plus Maven's built-in project.* properties.
+// Placeholders with no known value are left untouched.
+func substituteProperties(pom *POMFile, value string) string {
+	return pomPropertyRegex.ReplaceAllStringFunc(value, func(match string) string {
+		key := match[2 : len(match)-1]
+		switch key {
+		case "project.version":
+			return pom.Version
+		case "project.groupId":
+			return pom.GroupID
+		case "project.artifactId":
+			return pom.ArtifactID
+		}
+		if v, ok := pom.Properties[key]; ok {
+			return v
+		}
+		return match
+	})
+}
+
+// resolveDependencyVersion returns dep's version, substituting properties,
+// or, when the POM leaves it blank, looks it up in pom's accumulated
+// dependencyManagement, as Maven itself would. Coordinates are substituted
+// on both sides before comparing, since either dep's or a managed entry's
+// groupId/artifactId may itself be a ${property} placeholder.
+func resolveDependencyVersion(pom *POMFile, dep POMDependency) string {
+	if dep.Version != "" {
+		return substituteProperties(pom, dep.Version)
+	}
+
+	groupID := substituteProperties(pom, dep.GroupID)
+	artifactID := substituteProperties(pom, dep.ArtifactID)
+	for _, managed := range pom.DependencyManagement.Dependencies {
+		if substituteProperties(pom, managed.GroupID) == groupID && substituteProperties(pom, managed.ArtifactID) == artifactID {
+			return substituteProperties(pom, managed.Version)
+		}
+	}
+	return ""
+}
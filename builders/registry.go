@@ -0,0 +1,10 @@
+package builders
+
+// Builders maps each module type this package implements to its Builder
+// constructor, so DiscoverModules output actually has somewhere to
+// dispatch to. Other ecosystems' builder types are registered alongside
+// their own implementations.
+var Builders = map[string]func() Builder{
+	"mvn":        func() Builder { return &MavenBuilder{} },
+	"mvn-binary": func() Builder { return &MavenBinaryBuilder{} },
+}